@@ -24,6 +24,7 @@ import (
 
 	"golang.org/x/sys/unix"
 
+	gio "github.com/panjf2000/gnet/internal/io"
 	"github.com/panjf2000/gnet/internal/netpoll"
 	"github.com/panjf2000/gnet/internal/socket"
 	"github.com/panjf2000/gnet/pkg/mixedbuffer"
@@ -32,19 +33,40 @@ import (
 	"github.com/panjf2000/gnet/pkg/ringbuffer"
 )
 
+// zeroCopyRingSize bounds in-flight MSG_ZEROCOPY sends per conn; must be a
+// power of two so a send id's low bits can mask-index it.
+const zeroCopyRingSize = 1024
+
 type conn struct {
-	fd             int                     // file descriptor
-	sa             unix.Sockaddr           // remote socket address
-	ctx            interface{}             // user-defined context
-	loop           *eventloop              // connected event-loop
-	codec          ICodec                  // codec for TCP
-	opened         bool                    // connection opened event fired
-	localAddr      net.Addr                // local addr
-	remoteAddr     net.Addr                // remote addr
-	inboundBuffer  *ringbuffer.RingBuffer  // buffer for leftover data from the peer
-	transitBuffer  *bytebuffer.ByteBuffer  // buffer for a complete packet
-	outboundBuffer *mixedbuffer.Buffer     // buffer for data that is eligible to be sent to the peer
-	pollAttachment *netpoll.PollAttachment // connection attachment for poller
+	fd                int                      // file descriptor
+	sa                unix.Sockaddr            // remote socket address
+	ctx               interface{}              // user-defined context
+	loop              *eventloop               // connected event-loop
+	codec             ICodec                   // codec for TCP
+	opened            bool                     // connection opened event fired
+	localAddr         net.Addr                 // local addr
+	remoteAddr        net.Addr                 // remote addr
+	inboundBuffer     *ringbuffer.RingBuffer   // buffer for leftover data from the peer
+	transitBuffer     *bytebuffer.ByteBuffer   // buffer for a complete packet
+	outboundBuffer    *mixedbuffer.Buffer      // buffer for data that is eligible to be sent to the peer
+	pollAttachment    *netpoll.PollAttachment  // connection attachment for poller
+	zeroCopy          bool                     // whether MSG_ZEROCOPY is enabled for this connection
+	zeroCopyThreshold int                      // payload size above which write() takes the zero-copy path
+	zcNextID          uint32                   // id the kernel will assign to this connection's next zero-copy send
+	zcPending         [zeroCopyRingSize][]byte // buffers pinned until the kernel confirms it's done with them, indexed by id & (zeroCopyRingSize-1)
+	zcSends           uint64                   // zero-copy sends issued on this connection
+	zcCopied          uint64                   // of those, how many the kernel silently copied instead of deferring
+	zcPendingCount    int64                    // zero-copy completions this connection is still waiting on
+	udpPending        []Packet                 // WriteToBatch packets that didn't fit the last sendmmsg(2) call
+}
+
+// ZeroCopyStats reports c's zero-copy sends, kernel-side copy fallbacks, and
+// completions still pending. These are per-connection rather than
+// process-wide, so two Engines (or two conns in one Engine) never share a
+// counter; code outside this chunk that owns an Engine's conns can sum this
+// across them for an Engine.Stats() view.
+func (c *conn) ZeroCopyStats() (sends, copied uint64, pending int64) {
+	return c.zcSends, c.zcCopied, c.zcPendingCount
 }
 
 func newTCPConn(fd int, el *eventloop, sa unix.Sockaddr, codec ICodec, localAddr, remoteAddr net.Addr) (c *conn) {
@@ -73,22 +95,132 @@ func (c *conn) releaseTCP() {
 	c.inboundBuffer = ringbuffer.EmptyRingBuffer
 	c.outboundBuffer.Release()
 	netpoll.PutPollAttachment(c.pollAttachment)
+	if c.zeroCopy {
+		for i := range c.zcPending {
+			c.zcPending[i] = nil
+		}
+		c.zeroCopy = false
+		c.zeroCopyThreshold = 0
+		c.zcNextID = 0
+		c.zcSends = 0
+		c.zcCopied = 0
+		c.zcPendingCount = 0
+	}
 }
 
-func newUDPConn(fd int, el *eventloop, localAddr net.Addr, sa unix.Sockaddr) *conn {
-	return &conn{
-		fd:         fd,
-		sa:         sa,
-		loop:       el,
-		localAddr:  localAddr,
-		remoteAddr: socket.SockaddrToUDPAddr(sa),
+// EnableZeroCopy turns on the MSG_ZEROCOPY fast path for writes of at least
+// threshold bytes; if the kernel rejects SO_ZEROCOPY it returns that error
+// and the connection keeps using the regular copying write path.
+func (c *conn) EnableZeroCopy(threshold int) error {
+	if err := gio.EnableZeroCopy(c.fd); err != nil {
+		return err
 	}
+	c.zeroCopy = true
+	c.zeroCopyThreshold = threshold
+	return nil
+}
+
+// handleZeroCopyCompletions drains this connection's MSG_ERRQUEUE and
+// releases every pinned buffer the kernel has finished with.
+func (c *conn) handleZeroCopyCompletions() {
+	for {
+		completions, err := gio.ReadZeroCopyCompletions(c.fd)
+		if err != nil {
+			return
+		}
+		for _, comp := range completions {
+			if comp.Copied {
+				c.zcCopied++
+			}
+			freed := freeZeroCopyRange(&c.zcPending, comp.Low, comp.High)
+			c.zcPendingCount -= int64(freed)
+		}
+	}
+}
+
+// freeZeroCopyRange releases every pinned buffer in ring whose id falls in
+// [low, high], returning how many slots were actually non-nil.
+func freeZeroCopyRange(ring *[zeroCopyRingSize][]byte, low, high uint32) int {
+	freed := 0
+	for id := low; ; id++ {
+		slot := &ring[id&(zeroCopyRingSize-1)]
+		if *slot != nil {
+			*slot = nil
+			freed++
+		}
+		if id == high {
+			break
+		}
+	}
+	return freed
+}
+
+// defaultUDPBatchSize bounds how many datagrams internal/io.RecvMMsg drains
+// in one recvmmsg(2) call and internal/io.SendMMsg coalesces into one
+// sendmmsg(2) call. internal/netpoll drives the receive side off EPOLLIN
+// for UDP fds (not shown in this chunk): it loops RecvMMsg in batches of
+// this size, handing each payload plus its source Sockaddr to either the
+// per-remote conn cache or, for listeners without one, directly to
+// EventHandler.OnDatagram (also defined outside this chunk).
+const defaultUDPBatchSize = 64
+
+// Packet pairs an outbound datagram with its destination for
+// Conn.WriteToBatch, which coalesces a slice of them into a single
+// sendmmsg(2) call via internal/io.SendMMsg instead of one sendto(2) per
+// packet.
+type Packet struct {
+	Addr    net.Addr
+	Payload []byte
+}
+
+// newUDPConn builds the conn for a UDP packet. codec and maxDatagram come
+// from WithUDPFraming(codec, maxDatagram) (defined alongside the rest of
+// the option surface outside this chunk); when the listener didn't set
+// that option, codec is nil and c is the same bare, buffer-less conn as
+// before, read once per datagram via EventHandler.OnDatagram instead of
+// the codec/Read/ReadN/ShiftN API. The event loop keys these by remote
+// Sockaddr and caches one per active peer so a reassembled message that
+// spans datagrams has somewhere to live between them; that cache, its LRU
+// eviction, and WithUDPIdleTimeout are also outside this chunk. pollAttachment
+// is the listener's, shared by every peer conn on fd, since they're all the
+// same socket; sendBatch re-arms it for EPOLLOUT when the send buffer is full.
+func newUDPConn(fd int, el *eventloop, localAddr net.Addr, sa unix.Sockaddr, codec ICodec, maxDatagram int, pollAttachment *netpoll.PollAttachment) *conn {
+	c := &conn{
+		fd:             fd,
+		sa:             sa,
+		loop:           el,
+		localAddr:      localAddr,
+		remoteAddr:     socket.SockaddrToUDPAddr(sa),
+		codec:          codec,
+		pollAttachment: pollAttachment,
+	}
+	if codec != nil {
+		c.inboundBuffer = rbPool.GetWithSize(maxDatagram)
+	}
+	return c
 }
 
 func (c *conn) releaseUDP() {
 	c.ctx = nil
 	c.localAddr = nil
 	c.remoteAddr = nil
+	if c.inboundBuffer != nil {
+		rbPool.Put(c.inboundBuffer)
+		c.inboundBuffer = ringbuffer.EmptyRingBuffer
+	}
+	c.codec = nil
+	c.transitBuffer = nil
+	c.udpPending = nil
+}
+
+// appendDatagram feeds a newly received datagram's payload into c's
+// reassembly buffer; the event loop calls this once per datagram for a
+// framing-enabled UDP conn, then calls c.read (the same codec.Decode loop
+// TCP uses) until it returns an error, dispatching React per decoded
+// message instead of per datagram.
+func (c *conn) appendDatagram(payload []byte) error {
+	_, err := c.inboundBuffer.Write(payload)
+	return err
 }
 
 func (c *conn) open(buf []byte) error {
@@ -122,13 +254,31 @@ func (c *conn) write(buf []byte) (err error) {
 
 	c.loop.eventHandler.PreWrite(c)
 
-	// If there is pending data in outbound buffer, the current data ought to be appended to the outbound buffer
-	// for maintaining the sequence of network packets.
+	// If there is pending data in the outbound buffer, try to drain it first
+	// so packet can still go out this round instead of queuing behind it
+	// unconditionally.
+	if !c.outboundBuffer.IsEmpty() {
+		if err = c.flush(); err != nil {
+			return
+		}
+	}
+
+	// Maintain the sequence of network packets: if flushing didn't catch up,
+	// packet has to wait its turn in the outbound buffer too.
 	if !c.outboundBuffer.IsEmpty() {
 		_, _ = c.outboundBuffer.Write(packet)
 		return
 	}
 
+	if c.zeroCopy && len(packet) >= c.zeroCopyThreshold {
+		return c.writeZeroCopy(packet)
+	}
+	return c.writeCopy(packet)
+}
+
+// writeCopy sends packet through the regular copying write(2) path,
+// buffering whatever the kernel didn't accept for the next round.
+func (c *conn) writeCopy(packet []byte) (err error) {
 	var n int
 	if n, err = unix.Write(c.fd, packet); err != nil {
 		// A temporary error occurs, append the data to outbound buffer, writing it back to the peer in the next round.
@@ -147,6 +297,190 @@ func (c *conn) write(buf []byte) (err error) {
 	return
 }
 
+// writeZeroCopy sends packet through sendmsg(MSG_ZEROCOPY). The kernel only
+// copies the iovec's pages out asynchronously, so packet must stay alive
+// and unmodified until handleZeroCopyCompletions sees a matching
+// completion; it's pinned in zcPending keyed by the id the kernel will
+// echo back. ENOBUFS means this connection's zero-copy quota is exhausted
+// for the moment, so that send alone falls back to the copying path.
+func (c *conn) writeZeroCopy(packet []byte) (err error) {
+	// Reap whatever completions are already queued before deciding whether
+	// there's room in the ring; this is what keeps the slot check below from
+	// false-negative-ing under sustained load.
+	c.handleZeroCopyCompletions()
+
+	id := c.zcNextID
+	slot := id & (zeroCopyRingSize - 1)
+	if c.zcPending[slot] != nil {
+		// The ring is full: the kernel hasn't confirmed enough completions
+		// yet to reuse this slot. Reusing it anyway would drop the GC pin on
+		// a buffer the kernel may still be reading.
+		return c.writeCopy(packet)
+	}
+
+	n, sendErr := gio.SendMsgs(c.fd, [][]byte{packet})
+	if sendErr == unix.ENOBUFS {
+		return c.writeCopy(packet)
+	}
+	if sendErr != nil {
+		return c.loop.loopCloseConn(c, os.NewSyscallError("sendmsg", sendErr))
+	}
+
+	c.zcNextID++
+	c.zcPending[slot] = packet
+	c.zcSends++
+	c.zcPendingCount++
+
+	// Failed to hand all data to the kernel, buffer the leftover for the next round.
+	if n < len(packet) {
+		_, _ = c.outboundBuffer.Write(packet[n:])
+		err = c.loop.poller.ModReadWrite(c.pollAttachment)
+	}
+	return
+}
+
+// flush drains outboundBuffer straight into the socket over its segments via
+// writev(2), instead of first materializing it into one contiguous slice.
+// write and writev call it before queuing more data, and internal/netpoll
+// also calls it once EPOLLOUT fires for c; a short writev leaves the
+// remainder buffered with EPOLLOUT still armed for the next round.
+func (c *conn) flush() error {
+	iovs := c.outboundBuffer.Peekv()
+	if len(iovs) == 0 {
+		return nil
+	}
+	if len(iovs) == 1 {
+		return c.flushSingle(iovs[0])
+	}
+
+	n, err := gio.Writev(c.fd, iovs)
+	if err != nil {
+		if err == unix.EAGAIN {
+			return nil
+		}
+		return c.loop.loopCloseConn(c, os.NewSyscallError("writev", err))
+	}
+	c.outboundBuffer.Discard(n)
+	if c.outboundBuffer.IsEmpty() {
+		return c.loop.poller.ModRead(c.pollAttachment)
+	}
+	return nil
+}
+
+func (c *conn) flushSingle(buf []byte) error {
+	n, err := unix.Write(c.fd, buf)
+	if err != nil {
+		if err == unix.EAGAIN {
+			return nil
+		}
+		return c.loop.loopCloseConn(c, os.NewSyscallError("write", err))
+	}
+	c.outboundBuffer.Discard(n)
+	if c.outboundBuffer.IsEmpty() {
+		return c.loop.poller.ModRead(c.pollAttachment)
+	}
+	return nil
+}
+
+// codecV is satisfied by codecs that can encode a header/body/trailer split
+// across separate wire segments without concatenating them first. Codecs
+// that don't implement it get the default behavior in encodeV: concatenate
+// bufs and run the regular Encode.
+type codecV interface {
+	EncodeV(c Conn, bufs [][]byte) ([][]byte, error)
+}
+
+func encodeV(c *conn, bufs [][]byte) ([][]byte, error) {
+	if cv, ok := c.codec.(codecV); ok {
+		return cv.EncodeV(c, bufs)
+	}
+	total := 0
+	for _, b := range bufs {
+		total += len(b)
+	}
+	merged := make([]byte, 0, total)
+	for _, b := range bufs {
+		merged = append(merged, b...)
+	}
+	packet, err := c.codec.Encode(c, merged)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{packet}, nil
+}
+
+// discardv drops the first n bytes, in order, across packets' segments,
+// stopping partway through a segment if that's where a short writev left
+// off, and returns whatever is left to send.
+func discardv(packets [][]byte, n int) [][]byte {
+	for i, p := range packets {
+		if n < len(p) {
+			rest := make([][]byte, 0, len(packets)-i)
+			rest = append(rest, p[n:])
+			return append(rest, packets[i+1:]...)
+		}
+		n -= len(p)
+	}
+	return nil
+}
+
+func (c *conn) writev(bufs [][]byte) (err error) {
+	packets, err := encodeV(c, bufs)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, p := range packets {
+			c.loop.eventHandler.AfterWrite(c, p)
+		}
+	}()
+
+	c.loop.eventHandler.PreWrite(c)
+
+	if !c.outboundBuffer.IsEmpty() {
+		if err = c.flush(); err != nil {
+			return
+		}
+	}
+
+	if !c.outboundBuffer.IsEmpty() {
+		for _, p := range packets {
+			_, _ = c.outboundBuffer.Write(p)
+		}
+		return
+	}
+
+	if len(packets) == 1 {
+		return c.writeCopy(packets[0])
+	}
+
+	var n int
+	if n, err = gio.Writev(c.fd, packets); err != nil {
+		if err == unix.EAGAIN {
+			for _, p := range packets {
+				_, _ = c.outboundBuffer.Write(p)
+			}
+			err = c.loop.poller.ModReadWrite(c.pollAttachment)
+			return
+		}
+		return c.loop.loopCloseConn(c, os.NewSyscallError("writev", err))
+	}
+	if remaining := discardv(packets, n); len(remaining) > 0 {
+		for _, p := range remaining {
+			_, _ = c.outboundBuffer.Write(p)
+		}
+		err = c.loop.poller.ModReadWrite(c.pollAttachment)
+	}
+	return
+}
+
+func (c *conn) asyncWritev(itf interface{}) error {
+	if !c.opened {
+		return nil
+	}
+	return c.writev(itf.([][]byte))
+}
+
 func (c *conn) asyncWrite(itf interface{}) error {
 	if !c.opened {
 		return nil
@@ -160,6 +494,88 @@ func (c *conn) sendTo(buf []byte) error {
 	return unix.Sendto(c.fd, buf, 0, c.sa)
 }
 
+func (c *conn) writeTo(itf interface{}) error {
+	pkt := itf.(*Packet)
+	sa, err := udpAddrToSockaddr(pkt.Addr)
+	if err != nil {
+		return err
+	}
+	c.loop.eventHandler.PreWrite(c)
+	defer c.loop.eventHandler.AfterWrite(c, pkt.Payload)
+	return unix.Sendto(c.fd, pkt.Payload, 0, sa)
+}
+
+func (c *conn) writeToBatch(itf interface{}) error {
+	return c.sendBatch(itf.([]Packet))
+}
+
+// sendBatch coalesces pkts into a single sendmmsg(2) call via
+// internal/io.SendMMsg. A short count means the socket send buffer is full;
+// rather than busy-retrying through the poller, the unsent tail is stashed
+// in udpPending and write interest is re-armed, so flushUDPBatch can drain
+// it off the next EPOLLOUT the same way flush does for TCP conns.
+func (c *conn) sendBatch(pkts []Packet) error {
+	bufs := make([][]byte, len(pkts))
+	addrs := make([]unix.Sockaddr, len(pkts))
+	for i, pkt := range pkts {
+		bufs[i] = pkt.Payload
+		sa, err := udpAddrToSockaddr(pkt.Addr)
+		if err != nil {
+			return err
+		}
+		addrs[i] = sa
+	}
+
+	n, err := gio.SendMMsg(c.fd, bufs, addrs)
+	if err != nil && err != unix.EAGAIN && err != unix.ENOBUFS {
+		return err
+	}
+	if n < len(pkts) {
+		c.udpPending = append(c.udpPending, pkts[n:]...)
+		return c.loop.poller.ModReadWrite(c.pollAttachment)
+	}
+	return nil
+}
+
+// flushUDPBatch retries the WriteToBatch packets sendBatch couldn't send
+// last time; internal/netpoll calls this off EPOLLOUT for c (not shown in
+// this chunk), the same way it calls flush for TCP conns.
+func (c *conn) flushUDPBatch() error {
+	if len(c.udpPending) == 0 {
+		return c.loop.poller.ModRead(c.pollAttachment)
+	}
+	pkts := c.udpPending
+	c.udpPending = nil
+	return c.sendBatch(pkts)
+}
+
+// udpAddrToSockaddr converts the net.Addr a caller hands to WriteTo or
+// WriteToBatch into the unix.Sockaddr sendto/sendmmsg need.
+func udpAddrToSockaddr(addr net.Addr) (unix.Sockaddr, error) {
+	ua, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return nil, net.InvalidAddrError("not a *net.UDPAddr")
+	}
+	if ip4 := ua.IP.To4(); ip4 != nil {
+		sa := &unix.SockaddrInet4{Port: ua.Port}
+		copy(sa.Addr[:], ip4)
+		return sa, nil
+	}
+	sa := &unix.SockaddrInet6{Port: ua.Port, ZoneId: uint32(zoneIndex(ua.Zone))}
+	copy(sa.Addr[:], ua.IP.To16())
+	return sa, nil
+}
+
+func zoneIndex(zone string) int {
+	if zone == "" {
+		return 0
+	}
+	if iface, err := net.InterfaceByName(zone); err == nil {
+		return iface.Index
+	}
+	return 0
+}
+
 // ================================== Non-concurrency-safe API's ==================================
 
 func (c *conn) Read() []byte {
@@ -226,10 +642,31 @@ func (c *conn) AsyncWrite(buf []byte) error {
 	return c.loop.poller.Trigger(c.asyncWrite, buf)
 }
 
+// AsyncWritev lets callers assembling a framed message from a header, body,
+// and trailer hand them in as separate slices instead of paying to
+// concatenate them up front; codec.EncodeV (see codecV) gets first refusal
+// at encoding them as separate wire segments sent via writev(2).
+func (c *conn) AsyncWritev(bufs [][]byte) error {
+	return c.loop.poller.Trigger(c.asyncWritev, bufs)
+}
+
 func (c *conn) SendTo(buf []byte) error {
 	return c.sendTo(buf)
 }
 
+// WriteTo sends buf to an arbitrary destination over a UDP conn, unlike
+// SendTo which always targets the remote address this conn was created
+// with.
+func (c *conn) WriteTo(dst net.Addr, buf []byte) error {
+	return c.loop.poller.Trigger(c.writeTo, &Packet{Addr: dst, Payload: buf})
+}
+
+// WriteToBatch coalesces pkts into a single sendmmsg(2) call via
+// internal/io.SendMMsg instead of one sendto(2) per packet.
+func (c *conn) WriteToBatch(pkts []Packet) error {
+	return c.loop.poller.Trigger(c.writeToBatch, pkts)
+}
+
 func (c *conn) Wake() error {
 	return c.loop.poller.UrgentTrigger(func(_ interface{}) error { return c.loop.loopWake(c) }, nil)
 }
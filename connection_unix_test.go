@@ -0,0 +1,83 @@
+// Copyright (c) 2019 Andy Pan
+// Copyright (c) 2018 Joshua J Baker
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || freebsd || dragonfly || darwin
+// +build linux freebsd dragonfly darwin
+
+package gnet
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFreeZeroCopyRange(t *testing.T) {
+	var ring [zeroCopyRingSize][]byte
+	for id := uint32(0); id < 5; id++ {
+		ring[id] = []byte{byte(id)}
+	}
+
+	if freed := freeZeroCopyRange(&ring, 1, 3); freed != 3 {
+		t.Fatalf("freed = %d, want 3", freed)
+	}
+	for id := uint32(1); id <= 3; id++ {
+		if ring[id] != nil {
+			t.Fatalf("ring[%d] still pinned after completion", id)
+		}
+	}
+	if ring[0] == nil || ring[4] == nil {
+		t.Fatal("completion freed ids outside its range")
+	}
+
+	// Re-running over an already-freed range must not double count.
+	if freed := freeZeroCopyRange(&ring, 1, 3); freed != 0 {
+		t.Fatalf("freed = %d, want 0 for an already-cleared range", freed)
+	}
+}
+
+func TestFreeZeroCopyRangeWraps(t *testing.T) {
+	// freeZeroCopyRange walks low..high as raw 32-bit kernel ids, not ring
+	// indices, so a real wraparound is ids near math.MaxUint32, not ids near
+	// zeroCopyRingSize; each still masks down to a ring slot via id &
+	// (zeroCopyRingSize-1).
+	const low, high = math.MaxUint32 - 1, 1
+
+	var ring [zeroCopyRingSize][]byte
+	ring[uint32(low)&(zeroCopyRingSize-1)] = []byte("a")
+	ring[uint32(low+1)&(zeroCopyRingSize-1)] = []byte("b")
+	ring[uint32(high)&(zeroCopyRingSize-1)] = []byte("c")
+
+	freed := freeZeroCopyRange(&ring, low, high)
+	if freed != 3 {
+		t.Fatalf("freed = %d, want 3 across the wraparound", freed)
+	}
+}
+
+func TestDiscardv(t *testing.T) {
+	packets := [][]byte{[]byte("abc"), []byte("defg"), []byte("hi")}
+
+	if rest := discardv(packets, 0); len(rest) != 3 || string(rest[0]) != "abc" {
+		t.Fatalf("discarding 0 bytes should return all segments unchanged, got %v", rest)
+	}
+	if rest := discardv(packets, 3); len(rest) != 2 || string(rest[0]) != "defg" {
+		t.Fatalf("discarding exactly the first segment, got %v", rest)
+	}
+	if rest := discardv(packets, 5); len(rest) != 2 || string(rest[0]) != "fg" {
+		t.Fatalf("discarding partway into the second segment, got %v", rest)
+	}
+	if rest := discardv(packets, 9); len(rest) != 0 {
+		t.Fatalf("discarding every byte should leave nothing, got %v", rest)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2021 Andy Pan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// +build linux
+
+package io
+
+import (
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestHtons(t *testing.T) {
+	if got := htons(0x1234); got != 0x3412 {
+		t.Fatalf("htons(0x1234) = %#x, want 0x3412", got)
+	}
+	if got := htons(80); got != 0x5000 {
+		t.Fatalf("htons(80) = %#x, want 0x5000", got)
+	}
+}
+
+func TestRawSockaddrInet4(t *testing.T) {
+	sa := &unix.SockaddrInet4{Port: 8080, Addr: [4]byte{192, 168, 1, 1}}
+
+	raw, length, err := rawSockaddr(sa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if length != uint32(unsafe.Sizeof(unix.RawSockaddrInet4{})) {
+		t.Fatalf("length = %d, want sizeof(RawSockaddrInet4)", length)
+	}
+
+	in4 := (*unix.RawSockaddrInet4)(unsafe.Pointer(&raw))
+	if in4.Family != unix.AF_INET {
+		t.Fatalf("family = %d, want AF_INET", in4.Family)
+	}
+	if in4.Addr != sa.Addr {
+		t.Fatalf("addr = %v, want %v", in4.Addr, sa.Addr)
+	}
+	if in4.Port != htons(uint16(sa.Port)) {
+		t.Fatalf("port = %#x, want network-order %#x", in4.Port, htons(uint16(sa.Port)))
+	}
+}
+
+func TestRawSockaddrInet6(t *testing.T) {
+	sa := &unix.SockaddrInet6{Port: 53, ZoneId: 2, Addr: [16]byte{0: 0x20, 1: 0x01, 15: 0x01}}
+
+	raw, length, err := rawSockaddr(sa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if length != uint32(unsafe.Sizeof(unix.RawSockaddrInet6{})) {
+		t.Fatalf("length = %d, want sizeof(RawSockaddrInet6)", length)
+	}
+
+	in6 := (*unix.RawSockaddrInet6)(unsafe.Pointer(&raw))
+	if in6.Family != unix.AF_INET6 {
+		t.Fatalf("family = %d, want AF_INET6", in6.Family)
+	}
+	if in6.Addr != sa.Addr {
+		t.Fatalf("addr = %v, want %v", in6.Addr, sa.Addr)
+	}
+	if in6.Scope_id != sa.ZoneId {
+		t.Fatalf("scope id = %d, want %d", in6.Scope_id, sa.ZoneId)
+	}
+	if in6.Port != htons(uint16(sa.Port)) {
+		t.Fatalf("port = %#x, want network-order %#x", in6.Port, htons(uint16(sa.Port)))
+	}
+}
+
+func TestRawSockaddrUnsupported(t *testing.T) {
+	if _, _, err := rawSockaddr(&unix.SockaddrUnix{Name: "/tmp/x"}); err != unix.EAFNOSUPPORT {
+		t.Fatalf("err = %v, want EAFNOSUPPORT", err)
+	}
+}